@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Hasher describes one supported checksum algorithm: how to construct the
+// running hash, and which sidecar filenames carry it for a directory, or
+// as a per-file suffix.
+type Hasher struct {
+	Name         string
+	New          func() hash.Hash
+	SumFilenames []string // e.g. "SHA256SUMS", "sha256sum.txt"
+	FileSuffix   string   // e.g. ".sha256"
+}
+
+// hasherRegistry lists the algorithms tsumugu knows how to verify.
+// Adding blake3 or sha512 support is just another entry here.
+var hasherRegistry = []Hasher{
+	{
+		Name:         "sha256",
+		New:          sha256.New,
+		SumFilenames: []string{"SHA256SUMS", "sha256sum.txt"},
+		FileSuffix:   ".sha256",
+	},
+	{
+		Name:         "md5",
+		New:          md5.New,
+		SumFilenames: []string{"MD5SUMS", "md5sum.txt"},
+		FileSuffix:   ".md5",
+	},
+}
+
+// verifyMode controls how missing/failed checksums are handled; set once
+// from --verify.
+type verifyMode int
+
+const (
+	verifyAuto verifyMode = iota
+	verifyStrict
+	verifyOff
+)
+
+var verify = verifyAuto
+
+func parseVerifyMode(s string) (verifyMode, error) {
+	switch s {
+	case "auto", "":
+		return verifyAuto, nil
+	case "strict":
+		return verifyStrict, nil
+	case "off":
+		return verifyOff, nil
+	default:
+		return verifyAuto, fmt.Errorf("unknown --verify mode %q (want auto, strict or off)", s)
+	}
+}
+
+type checksumEntry struct {
+	hasher *Hasher
+	sum    string
+}
+
+// checksumCache remembers the sidecar sums already fetched for a
+// directory, keyed by its URL, so concurrent downloads from the same
+// directory don't each re-fetch SHA256SUMS.
+var checksumCache sync.Map
+
+// loadChecksums fetches and parses every known sidecar sums file (like
+// SHA256SUMS) found directly under dirURL, via activeLister so this works
+// the same way on --source=ftp and --source=s3 as it does over HTTP.
+func loadChecksums(dirURL *url.URL) map[string]checksumEntry {
+	if v, ok := checksumCache.Load(dirURL.String()); ok {
+		return v.(map[string]checksumEntry)
+	}
+
+	sums := make(map[string]checksumEntry)
+	for i := range hasherRegistry {
+		hasher := &hasherRegistry[i]
+		for _, name := range hasher.SumFilenames {
+			sidecarURL, err := urlBuilder(dirURL, name)
+			if err != nil {
+				continue
+			}
+			body, _, err := activeLister.FetchRange(sidecarURL, 0)
+			if err != nil {
+				continue
+			}
+			parseSumsFile(body, hasher, sums)
+			body.Close()
+		}
+	}
+
+	checksumCache.Store(dirURL.String(), sums)
+	return sums
+}
+
+// parseSumsFile parses the classic "<hex digest>  <filename>" format shared
+// by sha256sum/md5sum and friends (a leading "*" for binary mode is
+// stripped from the filename).
+func parseSumsFile(body io.Reader, hasher *Hasher, sums map[string]checksumEntry) {
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.TrimPrefix(fields[len(fields)-1], "*")
+		sums[name] = checksumEntry{hasher: hasher, sum: fields[0]}
+	}
+}
+
+// fetchSingleSum reads a per-file sidecar such as foo.tar.gz.sha256, which
+// usually holds either just the digest or "<digest>  foo.tar.gz", via
+// activeLister so this works the same way on --source=ftp and
+// --source=s3 as it does over HTTP.
+func fetchSingleSum(sidecarURL *url.URL) (string, bool) {
+	body, _, err := activeLister.FetchRange(sidecarURL, 0)
+	if err != nil {
+		return "", false
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+// checksumVerifier streams a download through the hash algorithm expected
+// for it (if any) via Reader, so verification costs no second pass over
+// the data; Verify reports whether the digest matched once the copy is
+// done.
+type checksumVerifier struct {
+	hasher   hash.Hash
+	expected string
+	algo     string
+	skip     bool
+	required bool // --verify=strict and no checksum could be found at all
+}
+
+// newChecksumVerifier looks up the checksum expected for fileURL, first in
+// its directory's bulk sums file, then as a per-file sidecar.
+func newChecksumVerifier(fileURL *url.URL) *checksumVerifier {
+	if verify == verifyOff {
+		return &checksumVerifier{skip: true}
+	}
+
+	dirURL := *fileURL
+	dirURL.Path = path.Dir(dirURL.Path) + "/"
+	filename := path.Base(fileURL.Path)
+
+	if sums := loadChecksums(&dirURL); sums != nil {
+		if entry, ok := sums[filename]; ok {
+			return &checksumVerifier{hasher: entry.hasher.New(), expected: entry.sum, algo: entry.hasher.Name}
+		}
+	}
+
+	for i := range hasherRegistry {
+		hasher := &hasherRegistry[i]
+		sidecarURL, err := urlBuilder(fileURL, filename+hasher.FileSuffix)
+		if err != nil {
+			continue
+		}
+		if sum, ok := fetchSingleSum(sidecarURL); ok {
+			return &checksumVerifier{hasher: hasher.New(), expected: sum, algo: hasher.Name}
+		}
+	}
+
+	return &checksumVerifier{skip: true, required: verify == verifyStrict}
+}
+
+// Reader wraps r so every byte read through it also feeds the checksum.
+func (v *checksumVerifier) Reader(r io.Reader) io.Reader {
+	if v.hasher == nil {
+		return r
+	}
+	return io.TeeReader(r, v.hasher)
+}
+
+// Verify reports a non-nil error if the downloaded content didn't match
+// the expected checksum, or (in strict mode) if no checksum was found.
+func (v *checksumVerifier) Verify() error {
+	if v.hasher == nil {
+		if v.required {
+			return fmt.Errorf("no checksum found and --verify=strict is set")
+		}
+		return nil
+	}
+	actual := hex.EncodeToString(v.hasher.Sum(nil))
+	if actual != v.expected {
+		return fmt.Errorf("%s mismatch: want %s, got %s", v.algo, v.expected, actual)
+	}
+	return nil
+}
+
+// VerifyFile re-hashes path from disk instead of trusting what Reader saw.
+// It's needed when a download resumed partway through: the hasher handed
+// to Reader never saw the bytes that were already on disk from an earlier,
+// interrupted attempt, so only a full re-read covers the whole file.
+func (v *checksumVerifier) VerifyFile(filePath string) error {
+	if v.hasher == nil {
+		return v.Verify()
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	v.hasher.Reset()
+	if _, err := io.Copy(v.hasher, f); err != nil {
+		return err
+	}
+	return v.Verify()
+}
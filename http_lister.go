@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// httpLister is the original Lister, scraping Apache/nginx/lighttpd-style
+// autoindex HTML pages over plain HTTP(S).
+//
+// crawl(), the legacy HTTP crawl path, never calls List or FetchRange on
+// this: it still does its own get()/getEntriesFromHTML() directly, since
+// a single fetch there has to double as both the directory listing *and*
+// the conditional-GET/redirect-based-symlink-detection request, which the
+// generic List/FetchRange contract has no way to express. So for
+// --source=http this struct only exists to satisfy the Lister interface
+// returned by NewLister.
+//
+// FetchRange isn't entirely dead, though: checksum.go's sidecar lookups
+// (loadChecksums/fetchSingleSum) go through activeLister.FetchRange for
+// every --source, including http, so this implementation is what backs
+// SHA256SUMS/MD5SUMS fetching when --source=http.
+type httpLister struct{}
+
+func (l *httpLister) List(dirURL *url.URL) ([]RemoteEntry, error) {
+	resp, finalURL, err := get(dirURL, fetchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("list of %s got status %d", finalURL.String(), resp.StatusCode)
+	}
+
+	files := getEntriesFromHTML(resp.Body)
+	entries := make([]RemoteEntry, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, RemoteEntry{
+			Name:              f.Name,
+			IsDir:             strings.HasSuffix(f.Name, "/"),
+			Size:              f.Size,
+			ModTime:           f.ModTime,
+			ModTimeMinuteOnly: true,
+		})
+	}
+	return entries, nil
+}
+
+func (l *httpLister) FetchRange(fileURL *url.URL, offset int64) (io.ReadCloser, bool, error) {
+	resp, finalURL, err := get(fileURL, fetchOptions{RangeStart: offset})
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("fetch of %s got status %d", finalURL.String(), resp.StatusCode)
+	}
+	return resp.Body, resp.StatusCode == http.StatusPartialContent, nil
+}
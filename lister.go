@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// RemoteEntry is a single file or directory reported by a Lister, in a
+// transport-agnostic shape shared by the HTTP, FTP and S3 backends.
+type RemoteEntry struct {
+	Name    string
+	IsDir   bool
+	Size    int64     // -1 when unknown
+	ModTime time.Time // zero value when unknown
+	// ModTimeMinuteOnly is true when ModTime came from a source that only
+	// has minute-level precision (Apache/nginx/lighttpd autoindex pages),
+	// as opposed to ftp/s3, which report real second-precision mtimes.
+	// isRemoteFileUpToDate needs this to know whether it's safe to
+	// truncate the local file's mtime down to the minute before
+	// comparing, or whether that would make an exact match look stale.
+	ModTimeMinuteOnly bool
+}
+
+// Lister abstracts the two operations tsumugu needs from a mirror source:
+// listing a directory's entries, and fetching a single file's content.
+// This is what lets --source switch between scraping HTML autoindex
+// pages, talking FTP, or reading an S3-style bucket listing, without the
+// rest of crawl's sync/remove logic having to know which one is in use.
+type Lister interface {
+	// List returns the entries found directly under dirURL.
+	List(dirURL *url.URL) ([]RemoteEntry, error)
+	// FetchRange opens fileURL for reading starting at the given byte
+	// offset (0 meaning the whole file), mirroring how get() handles
+	// Range requests for the plain HTTP path. resumed reports whether the
+	// backend actually honored offset; if false the caller must discard
+	// anything it already has on disk and treat body as the file from
+	// scratch.
+	FetchRange(fileURL *url.URL, offset int64) (body io.ReadCloser, resumed bool, err error)
+}
+
+// Implementations of List and FetchRange are each responsible for calling
+// throttle() and checking activeRobots.Allowed() for the URL they're
+// about to fetch - callers (crawlGeneric, the checksum sidecar lookups)
+// don't re-check around every call, since a single crawlGeneric
+// invocation can make several of these calls (directory listing, a
+// download, its retries) that each need their own turn through the rate
+// limiter.
+
+// activeLister is the backend selected by --source; it's set once in
+// main() before any crawling starts.
+var activeLister Lister
+
+// NewLister builds the Lister for the given --source flag value.
+func NewLister(source string) (Lister, error) {
+	switch source {
+	case "http", "":
+		return &httpLister{}, nil
+	case "ftp":
+		return &ftpLister{}, nil
+	case "s3":
+		return &s3Lister{}, nil
+	default:
+		return nil, fmt.Errorf("unknown source %q (want http, ftp or s3)", source)
+	}
+}
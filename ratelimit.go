@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// globalRateLimit is the --rate-limit ceiling (requests/sec per host),
+// applied on top of whatever crawl-delay robots.txt asks for. Zero means
+// no limit of its own.
+var globalRateLimit float64
+
+// hostLimiters holds the per-host token bucket used to throttle crawl(),
+// keyed by hostname, mirroring how checksumCache is keyed per directory.
+var hostLimiters sync.Map
+
+// limiterFor returns (creating if necessary) the rate.Limiter for host,
+// combining --rate-limit with robots.txt's Crawl-delay for our group,
+// whichever is more restrictive.
+func limiterFor(host string) *rate.Limiter {
+	if v, ok := hostLimiters.Load(host); ok {
+		return v.(*rate.Limiter)
+	}
+
+	limit := rate.Inf
+	if globalRateLimit > 0 {
+		limit = rate.Limit(globalRateLimit)
+	}
+	if activeRobots != nil && activeRobots.crawlDelay > 0 {
+		if perSec := rate.Limit(1 / activeRobots.crawlDelay.Seconds()); perSec < limit {
+			limit = perSec
+		}
+	}
+
+	limiter := rate.NewLimiter(limit, 1)
+	actual, _ := hostLimiters.LoadOrStore(host, limiter)
+	return actual.(*rate.Limiter)
+}
+
+// throttle blocks until host's token bucket allows another request.
+func throttle(host string) {
+	limiterFor(host).Wait(context.Background())
+}
+
+// userAgentRoundTripper sets a fixed User-Agent header on every outgoing
+// request, since http.Client has no simpler hook for a static header.
+type userAgentRoundTripper struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsPolicy is the subset of a robots.txt that applies to tsumugu: the
+// Disallow/Allow rules for our user-agent (or the wildcard group if we're
+// not named explicitly), and any Crawl-delay.
+type robotsPolicy struct {
+	disallow   []string
+	allow      []string
+	crawlDelay time.Duration
+}
+
+// activeRobots is the policy fetched once at startup from boundaryHost's
+// /robots.txt. A nil activeRobots (or an empty one) allows everything.
+var activeRobots *robotsPolicy
+
+// fetchRobots fetches and parses /robots.txt from base's host. Any
+// failure to fetch it (missing, network error, non-200) is treated as "no
+// restrictions" rather than aborting the mirror.
+func fetchRobots(base *url.URL, userAgent string) *robotsPolicy {
+	robotsURL := *base
+	robotsURL.Path = "/robots.txt"
+	robotsURL.RawQuery = ""
+
+	resp, err := StandardClient.Get(robotsURL.String())
+	if err != nil {
+		log.Printf("Fetching %s failed: %v, assuming no crawl restrictions\n", robotsURL.String(), err)
+		return &robotsPolicy{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &robotsPolicy{}
+	}
+
+	return parseRobots(resp.Body, userAgent)
+}
+
+// parseRobots implements enough of the robots.txt format to be a good
+// citizen: per-User-agent groups of Disallow/Allow/Crawl-delay. Our own
+// group (matched on the product token before "/" in userAgent) takes
+// precedence over the wildcard "*" group.
+//
+// A group is one or more consecutive User-agent lines followed by the
+// directives that apply to all of them - e.g. "User-agent: a" followed by
+// "User-agent: b" followed by "Disallow: /x" disallows /x for both a and
+// b. groupTargets tracks every policy named by the run of User-agent
+// lines currently being read, and is only reset once a directive line
+// closes the group, so a later User-agent line in the same run can't
+// silently drop an earlier match from it.
+func parseRobots(body io.Reader, userAgent string) *robotsPolicy {
+	ourProduct := strings.ToLower(strings.SplitN(userAgent, "/", 2)[0])
+
+	var forUs, forAll *robotsPolicy
+	var groupTargets []*robotsPolicy
+	inGroup := false
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		field := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch field {
+		case "user-agent":
+			if !inGroup {
+				groupTargets = nil
+			}
+			switch strings.ToLower(value) {
+			case "*":
+				if forAll == nil {
+					forAll = &robotsPolicy{}
+				}
+				groupTargets = append(groupTargets, forAll)
+			case ourProduct:
+				if forUs == nil {
+					forUs = &robotsPolicy{}
+				}
+				groupTargets = append(groupTargets, forUs)
+			}
+			inGroup = true
+		case "disallow":
+			inGroup = false
+			if value != "" {
+				for _, p := range groupTargets {
+					p.disallow = append(p.disallow, value)
+				}
+			}
+		case "allow":
+			inGroup = false
+			if value != "" {
+				for _, p := range groupTargets {
+					p.allow = append(p.allow, value)
+				}
+			}
+		case "crawl-delay":
+			inGroup = false
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				for _, p := range groupTargets {
+					p.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	if forUs != nil {
+		return forUs
+	}
+	if forAll != nil {
+		return forAll
+	}
+	return &robotsPolicy{}
+}
+
+// Allowed reports whether path may be fetched, using the usual
+// longest-matching-rule-wins algorithm; a tie between an Allow and a
+// Disallow of the same length favors Allow.
+func (p *robotsPolicy) Allowed(path string) bool {
+	if p == nil {
+		return true
+	}
+	bestLen := -1
+	allowed := true
+	for _, rule := range p.disallow {
+		if strings.HasPrefix(path, rule) && len(rule) > bestLen {
+			bestLen = len(rule)
+			allowed = false
+		}
+	}
+	for _, rule := range p.allow {
+		if strings.HasPrefix(path, rule) && len(rule) >= bestLen {
+			bestLen = len(rule)
+			allowed = true
+		}
+	}
+	return allowed
+}
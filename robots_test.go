@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRobotsMultiAgentGroup(t *testing.T) {
+	robots := `User-agent: ourproduct
+User-agent: someotherbot
+Disallow: /private/
+Crawl-delay: 5
+`
+	policy := parseRobots(strings.NewReader(robots), "ourproduct/1.0")
+	if policy.Allowed("/private/file") {
+		t.Error("expected /private/file to be disallowed for a group naming ourproduct alongside another agent")
+	}
+	if policy.crawlDelay.Seconds() != 5 {
+		t.Errorf("expected crawl-delay 5s, got %s", policy.crawlDelay)
+	}
+}
+
+func TestParseRobotsOwnGroupBeatsWildcard(t *testing.T) {
+	robots := `User-agent: *
+Disallow: /
+
+User-agent: ourproduct
+Disallow: /private/
+Allow: /
+`
+	policy := parseRobots(strings.NewReader(robots), "ourproduct/1.0")
+	if policy.Allowed("/private/file") {
+		t.Error("expected /private/file to be disallowed")
+	}
+	if !policy.Allowed("/public/file") {
+		t.Error("expected /public/file to be allowed by our own group, not the wildcard group")
+	}
+}
+
+func TestAllowedLongestRuleWins(t *testing.T) {
+	robots := `User-agent: *
+Disallow: /a/
+Allow: /a/b/
+`
+	policy := parseRobots(strings.NewReader(robots), "ourproduct/1.0")
+	if policy.Allowed("/a/c") {
+		t.Error("expected /a/c to be disallowed")
+	}
+	if !policy.Allowed("/a/b/c") {
+		t.Error("expected /a/b/c to be allowed by the longer, more specific Allow rule")
+	}
+}
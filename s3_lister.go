@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// s3ListBucketResult is the subset of S3's ListObjectsV2 XML response that
+// tsumugu needs to reconstruct a directory listing.
+type s3ListBucketResult struct {
+	XMLName        xml.Name         `xml:"ListBucketResult"`
+	Contents       []s3Object       `xml:"Contents"`
+	CommonPrefixes []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// s3Lister lists S3-compatible buckets that expose their contents as an
+// XML ListBucketResult, which most bucket-hosted mirrors do via a plain
+// GET with ?list-type=2&delimiter=/&prefix=....
+type s3Lister struct{}
+
+func (l *s3Lister) List(dirURL *url.URL) ([]RemoteEntry, error) {
+	if !activeRobots.Allowed(dirURL.Path) {
+		return nil, fmt.Errorf("%s disallowed by robots.txt", dirURL.String())
+	}
+	throttle(dirURL.Hostname())
+
+	prefix := strings.TrimPrefix(dirURL.Path, "/")
+
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("delimiter", "/")
+	query.Set("prefix", prefix)
+
+	listURL := *dirURL
+	listURL.Path = "/"
+	listURL.RawQuery = query.Encode()
+
+	resp, err := StandardClient.Get(listURL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3 list of %s got status %d", listURL.String(), resp.StatusCode)
+	}
+
+	var result s3ListBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	var entries []RemoteEntry
+	for _, p := range result.CommonPrefixes {
+		entries = append(entries, RemoteEntry{
+			Name:  strings.TrimPrefix(p.Prefix, prefix),
+			IsDir: true,
+			Size:  -1,
+		})
+	}
+	for _, obj := range result.Contents {
+		name := strings.TrimPrefix(obj.Key, prefix)
+		if name == "" {
+			continue // the "directory marker" object for prefix itself
+		}
+		entries = append(entries, RemoteEntry{
+			Name:    name,
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+	return entries, nil
+}
+
+func (l *s3Lister) FetchRange(fileURL *url.URL, offset int64) (io.ReadCloser, bool, error) {
+	if !activeRobots.Allowed(fileURL.Path) {
+		return nil, false, fmt.Errorf("%s disallowed by robots.txt", fileURL.String())
+	}
+	throttle(fileURL.Hostname())
+
+	req, err := http.NewRequest(http.MethodGet, fileURL.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := StandardClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("s3 fetch of %s got status %d", fileURL.String(), resp.StatusCode)
+	}
+	return resp.Body, resp.StatusCode == http.StatusPartialContent, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// symlinkTmpSuffix names the scratch symlink created next to fromFullPath
+// before it's renamed into place, so a concurrent reader never observes a
+// missing or half-written link.
+const symlinkTmpSuffix = ".tsumugu-symlink-tmp"
+
+// createOrUpdateSymlink makes fromFullPath a relative symlink to
+// toFullPath, creating it if absent and replacing it (atomically, via
+// rename) if it already points somewhere else - which happens when the
+// remote redirect target moves between mirror runs.
+func createOrUpdateSymlink(fromFullPath, toFullPath string) error {
+	rel, err := filepath.Rel(filepath.Dir(fromFullPath), toFullPath)
+	if err != nil {
+		return fmt.Errorf("resolve relative symlink target: %w", err)
+	}
+
+	if existing, err := os.Readlink(fromFullPath); err == nil {
+		if existing == rel {
+			return nil
+		}
+	} else if _, statErr := os.Lstat(fromFullPath); statErr == nil {
+		return fmt.Errorf("%s already exists and isn't a symlink", fromFullPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fromFullPath), 0755); err != nil {
+		return err
+	}
+
+	tmpPath := fromFullPath + symlinkTmpSuffix
+	os.Remove(tmpPath)
+	if err := os.Symlink(rel, tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, fromFullPath)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateOrUpdateSymlinkCreatesNew(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "latest")
+	to := filepath.Join(dir, "v1.0", "file.tar.gz")
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(to, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createOrUpdateSymlink(from, to); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "v1.0/file.tar.gz" {
+		t.Errorf("expected relative target v1.0/file.tar.gz, got %s", target)
+	}
+}
+
+func TestCreateOrUpdateSymlinkTargetChangedRemotely(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "latest")
+	oldTo := filepath.Join(dir, "v1.0", "file.tar.gz")
+	newTo := filepath.Join(dir, "v2.0", "file.tar.gz")
+
+	for _, p := range []string{oldTo, newTo} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := createOrUpdateSymlink(from, oldTo); err != nil {
+		t.Fatal(err)
+	}
+
+	// The remote redirect now points somewhere else; the local symlink
+	// should follow it.
+	if err := createOrUpdateSymlink(from, newTo); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "v2.0/file.tar.gz" {
+		t.Errorf("expected relative target to be updated to v2.0/file.tar.gz, got %s", target)
+	}
+}
+
+func TestCreateOrUpdateSymlinkNoopWhenUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "latest")
+	to := filepath.Join(dir, "v1.0", "file.tar.gz")
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(to, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createOrUpdateSymlink(from, to); err != nil {
+		t.Fatal(err)
+	}
+	if err := createOrUpdateSymlink(from, to); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "v1.0/file.tar.gz" {
+		t.Errorf("expected relative target v1.0/file.tar.gz, got %s", target)
+	}
+}
@@ -10,13 +10,16 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// version is reported in the default User-Agent string.
+const version = "0.1.0"
+
 // StandardClient the default client that traverse uses.
 var StandardClient = &http.Client{
 	// Timeout: time.Second * 30,
@@ -29,18 +32,128 @@ var boundaryHost string // same domain with different ports is acceptable here.
 var dry = false
 var excludeList []string // TODO: Implement exclusion when downloading
 
+// partialSuffix names the stable on-disk file a download is streamed into
+// before it's complete, so an interrupted download can be resumed by
+// sending a Range request for what's already on disk instead of starting
+// over.
+const partialSuffix = ".tsumugu-part"
+
+// etagSuffix names the sidecar file a download's ETag response header is
+// saved to, so a later sync can send it back as If-None-Match and let a
+// 304 response short-circuit the download the same way If-Modified-Since
+// already does with mtimes.
+const etagSuffix = ".tsumugu-etag"
+
+// isSidecarFile reports whether name is one of tsumugu's own on-disk
+// metadata files rather than a mirrored remote entry, so the local
+// directory scans that feed getSyncAndRemoveList can skip them - without
+// this they'd be seen as stray local files with no remote match and
+// deleted, usually right before crawl() needs to read them.
+func isSidecarFile(name string) bool {
+	return strings.HasSuffix(name, partialSuffix) || strings.HasSuffix(name, etagSuffix)
+}
+
+// readLocalETag returns the ETag saved next to fullPath by a previous
+// successful download, if any.
+func readLocalETag(fullPath string) string {
+	data, err := ioutil.ReadFile(fullPath + etagSuffix)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// saveLocalETag stores resp's ETag header next to fullPath for a future
+// conditional GET, removing any stale one if the response didn't send one.
+func saveLocalETag(fullPath string, header http.Header) {
+	etagPath := fullPath + etagSuffix
+	etag := header.Get("ETag")
+	if etag == "" {
+		os.Remove(etagPath)
+		return
+	}
+	if err := ioutil.WriteFile(etagPath, []byte(etag), 0644); err != nil {
+		log.Printf("Write ETag for %s failed: %v\n", fullPath, err)
+	}
+}
+
+// maxRetries and retryBaseDelay control get()'s retry behaviour on
+// transient network errors (not HTTP status codes); maxRetries also
+// bounds the re-downloads after a failed checksum verification. maxRetries
+// is set from --max-retries; retryBaseDelay is fixed.
+var maxRetries = 0
+var retryBaseDelay = time.Second
+
 // File a simple struct representing local files
 type File struct {
-	name  string
-	isDir bool
+	name    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// QueueItem is a URL queued for crawling. localModTime is non-zero when a
+// local file is already expected to be at that URL, so the fetch can be
+// made conditional instead of always re-downloading. remoteModTime is the
+// listing's ModTime for the entry (zero if unknown), stamped onto the
+// downloaded file via os.Chtimes so a later sync can compare mtimes
+// instead of re-fetching. isDir is used by the non-HTTP Lister backends,
+// which already know an entry's kind from the parent directory's listing
+// and so don't need to fetch it to find out.
+type QueueItem struct {
+	url           *url.URL
+	localModTime  time.Time
+	remoteModTime time.Time
+	isDir         bool
 }
 
-func get(url *url.URL) (*http.Response, *url.URL, error) {
+// fetchOptions carries the optional headers get() may need to set:
+// IfModifiedSince and IfNoneMatch for a conditional GET, and RangeStart
+// to resume a partially-downloaded file.
+type fetchOptions struct {
+	IfModifiedSince time.Time
+	IfNoneMatch     string
+	RangeStart      int64
+}
+
+func get(url *url.URL, opts fetchOptions) (*http.Response, *url.URL, error) {
+	if !activeRobots.Allowed(url.Path) {
+		return nil, url, fmt.Errorf("%s disallowed by robots.txt", url.String())
+	}
+	throttle(url.Hostname())
+
 	urlString := url.String()
-	resp, err := StandardClient.Get(urlString)
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, urlString, nil)
+		if err != nil {
+			return nil, url, err
+		}
+		if !opts.IfModifiedSince.IsZero() {
+			req.Header.Set("If-Modified-Since", opts.IfModifiedSince.UTC().Format(http.TimeFormat))
+		}
+		if opts.IfNoneMatch != "" {
+			req.Header.Set("If-None-Match", opts.IfNoneMatch)
+		}
+		if opts.RangeStart > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", opts.RangeStart))
+		}
+
+		resp, err = StandardClient.Do(req)
+		if err == nil || attempt >= maxRetries {
+			break
+		}
+		delay := retryBaseDelay * time.Duration(int64(1)<<uint(attempt))
+		log.Printf("GET %s failed (attempt %d/%d): %v, retrying in %s\n", urlString, attempt+1, maxRetries+1, err, delay)
+		time.Sleep(delay)
+	}
 	if err != nil {
 		return nil, url, err
 	}
+
 	finalURL := resp.Request.URL
 	err = isURLOutOfBoundary(finalURL)
 	if err != nil {
@@ -50,10 +163,32 @@ func get(url *url.URL) (*http.Response, *url.URL, error) {
 	return resp, resp.Request.URL, nil
 }
 
-func crawl(url *url.URL, queue chan *url.URL, baseFolder string) {
+func crawl(item *QueueItem, queue chan *QueueItem, baseFolder string) {
+	if _, isHTTP := activeLister.(*httpLister); !isHTTP {
+		crawlGeneric(item, queue, baseFolder)
+		return
+	}
+
+	url := item.url
 	fmt.Printf("Handling URL %s\n", url.String())
+	if !activeRobots.Allowed(url.Path) {
+		fmt.Printf("%s disallowed by robots.txt, skipping.\n", url.String())
+		return
+	}
 	if _, loaded := visited.LoadOrStore(url.String(), true); !loaded {
-		resp, finalURL, err := get(url)
+		// get() below throttles and re-checks robots.txt itself for the
+		// URL it actually fetches, so every request (including the
+		// sidecar checksum fetches triggered further down) is covered,
+		// not just this one.
+		var resumeFrom int64
+		expectedPath := filepath.Join(baseFolder, getFileRelPath(url))
+		partPath := expectedPath + partialSuffix
+		if stat, err := os.Stat(partPath); err == nil {
+			resumeFrom = stat.Size()
+		}
+		localETag := readLocalETag(expectedPath)
+
+		resp, finalURL, err := get(url, fetchOptions{IfModifiedSince: item.localModTime, IfNoneMatch: localETag, RangeStart: resumeFrom})
 		if err != nil {
 			log.Println(err)
 			return
@@ -61,6 +196,10 @@ func crawl(url *url.URL, queue chan *url.URL, baseFolder string) {
 		defer resp.Body.Close()
 
 		fmt.Printf("%s: %d\n", finalURL.String(), resp.StatusCode)
+		if resp.StatusCode == http.StatusNotModified {
+			fmt.Printf("%s not modified, skipping.\n", finalURL.String())
+			return
+		}
 		statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
 		if !statusOK {
 			log.Printf("URL %s got %d\n", finalURL.String(), resp.StatusCode)
@@ -71,19 +210,11 @@ func crawl(url *url.URL, queue chan *url.URL, baseFolder string) {
 				fromFullPath := filepath.Join(baseFolder, fromPath)
 				toFullPath := filepath.Join(baseFolder, toPath)
 				if fromFullPath != toFullPath {
-					// create symlink
-					// TODO: replace ln -sr with os.Symlink
-					// TODO: change symlink when it is changed on remote
-					if _, err := os.Stat(fromFullPath); os.IsNotExist(err) {
-						cmd := exec.Command("gln", "-sr", toFullPath, fromFullPath)
-						output, err := cmd.Output()
-						fmt.Println(output)
-						if err != nil {
-							fmt.Printf("Create symlink %s -> %s failed: %v with (%s)\n", toFullPath, fromFullPath, err, err.(*exec.ExitError).Stderr)
-						}
+					if err := createOrUpdateSymlink(fromFullPath, toFullPath); err != nil {
+						log.Printf("Create symlink %s -> %s failed: %v\n", fromFullPath, toFullPath, err)
 					}
 				}
-				queue <- finalURL
+				queue <- &QueueItem{url: finalURL}
 			} else if IsHTML(resp.Header) {
 				folderRelPath := getFileRelPath(finalURL)
 				folderPath := filepath.Join(baseFolder, folderRelPath)
@@ -92,9 +223,9 @@ func crawl(url *url.URL, queue chan *url.URL, baseFolder string) {
 					log.Printf("Create %s failed: %v\n", folderPath, err)
 					return
 				}
-				hrefs := getHrefsFromHTML(resp.Body)
+				entries := getEntriesFromHTML(resp.Body)
 
-				remoteList := generateRemoteFileList(finalURL, hrefs)
+				remoteList := generateRemoteFileList(finalURL, entries)
 				localFileInfoList, err := ioutil.ReadDir(folderPath)
 				if err != nil {
 					log.Printf("Error when reading folder %s: %v\n", folderPath, err)
@@ -102,7 +233,15 @@ func crawl(url *url.URL, queue chan *url.URL, baseFolder string) {
 				}
 				var localList []File
 				for _, file := range localFileInfoList {
-					localList = append(localList, File{filepath.Join(folderRelPath, file.Name()), file.IsDir()})
+					if isSidecarFile(file.Name()) {
+						continue
+					}
+					localList = append(localList, File{
+						name:    filepath.Join(folderRelPath, file.Name()),
+						isDir:   file.IsDir(),
+						size:    file.Size(),
+						modTime: file.ModTime(),
+					})
 				}
 
 				syncList, removeList := getSyncAndRemoveList(remoteList, localList)
@@ -118,45 +257,65 @@ func crawl(url *url.URL, queue chan *url.URL, baseFolder string) {
 					}
 				}
 
-				for _, href := range syncList {
-					newURL, err := urlBuilder(boundaryPrefixURL, href)
+				for _, syncItem := range syncList {
+					newURL, err := urlBuilder(boundaryPrefixURL, syncItem.name)
 					if err != nil {
-						log.Printf("Failed when building URL %s with %s: %v\n", finalURL.String(), href, err)
+						log.Printf("Failed when building URL %s with %s: %v\n", finalURL.String(), syncItem.name, err)
 					} else {
 						log.Printf("Add %s to queue\n", newURL.String())
-						queue <- newURL
+						queue <- &QueueItem{url: newURL, localModTime: syncItem.localModTime, remoteModTime: syncItem.remoteModTime}
 					}
 				}
 			} else {
 				downloadPath := getFileRelPath(finalURL)
 				downloadPath = filepath.Join(baseFolder, downloadPath)
-				if _, err := os.Stat(downloadPath); os.IsNotExist(err) {
-					fmt.Printf("Downloading %s -> %s\n", finalURL.String(), downloadPath)
+				partPath := downloadPath + partialSuffix
 
-					out, err := ioutil.TempFile(filepath.Dir(downloadPath), filepath.Base(downloadPath))
-					if err != nil {
-						log.Printf("Create tmp file failed: %v\n", err)
-						return
+				resuming := resp.StatusCode == http.StatusPartialContent
+				if !resuming {
+					if resumeFrom > 0 {
+						log.Printf("%s doesn't support range requests, restarting download from scratch\n", finalURL.String())
 					}
-					defer os.Remove(out.Name())
+					resumeFrom = 0
+				}
 
-					if !dry {
-						_, err = io.Copy(out, resp.Body)
+				fmt.Printf("Downloading %s -> %s (resuming from byte %d)\n", finalURL.String(), downloadPath, resumeFrom)
+
+				if !dry {
+					verifier := newChecksumVerifier(finalURL)
+					verifyErr := downloadToPartFile(resp.Body, partPath, resuming, resumeFrom, verifier)
+					for attempt := 0; verifyErr != nil && attempt < maxRetries; attempt++ {
+						log.Printf("Checksum verification of %s failed (attempt %d/%d): %v, retrying from scratch\n", downloadPath, attempt+1, maxRetries+1, verifyErr)
+						os.Remove(partPath)
+						retryResp, _, err := get(finalURL, fetchOptions{})
 						if err != nil {
-							log.Println(err)
-							return
+							verifyErr = err
+							continue
 						}
-					} else {
-						fmt.Println("Dry run (not actually downloading)")
+						verifier = newChecksumVerifier(finalURL)
+						verifyErr = downloadToPartFile(retryResp.Body, partPath, false, 0, verifier)
+						retryResp.Body.Close()
 					}
-
-					err = os.Rename(out.Name(), downloadPath)
-					if err != nil {
-						log.Printf("Move %s -> %s failed: %v\n", out.Name(), downloadPath, err)
+					if verifyErr != nil {
+						os.Remove(partPath)
+						log.Printf("Checksum verification of %s failed after %d attempt(s): %v\n", downloadPath, maxRetries+1, verifyErr)
+						return
 					}
 				} else {
-					fmt.Printf("%s exists.\n", downloadPath)
+					fmt.Println("Dry run (not actually downloading)")
+				}
+
+				err = os.Rename(partPath, downloadPath)
+				if err != nil {
+					log.Printf("Move %s -> %s failed: %v\n", partPath, downloadPath, err)
+					return
+				}
+				if !item.remoteModTime.IsZero() {
+					if err := os.Chtimes(downloadPath, item.remoteModTime, item.remoteModTime); err != nil {
+						log.Printf("Chtimes %s failed: %v\n", downloadPath, err)
+					}
 				}
+				saveLocalETag(downloadPath, resp.Header)
 				return
 			}
 		}
@@ -165,7 +324,191 @@ func crawl(url *url.URL, queue chan *url.URL, baseFolder string) {
 	}
 }
 
-func parseAndPush(targetString string, queue chan *url.URL, addTrailingSlash bool) error {
+// downloadToPartFile copies body into partPath - appending if resumed,
+// truncating otherwise - and verifies the result against verifier: when
+// resumeFrom is nonzero it re-hashes the whole part file from disk (the
+// streamed hash only saw the resumed tail), otherwise it checks the hash
+// taken while streaming. It's shared by crawl's plain-HTTP download path and
+// fetchAndVerify below, which only differ in how they obtain body.
+func downloadToPartFile(body io.Reader, partPath string, resumed bool, resumeFrom int64, verifier *checksumVerifier) error {
+	openFlag := os.O_CREATE | os.O_WRONLY
+	if resumed {
+		openFlag |= os.O_APPEND
+	} else {
+		openFlag |= os.O_TRUNC
+	}
+
+	out, err := os.OpenFile(partPath, openFlag, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, verifier.Reader(body))
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	if resumeFrom > 0 {
+		return verifier.VerifyFile(partPath)
+	}
+	return verifier.Verify()
+}
+
+// fetchAndVerify is crawlGeneric's counterpart to the inline fetch+verify
+// logic in crawl(): it drives a Lister's FetchRange instead of get(), so
+// the same resume/checksum behaviour applies uniformly to the ftp and s3
+// backends, whose FetchRange reports resumption as a bool rather than as
+// an HTTP status code.
+func fetchAndVerify(fileURL *url.URL, partPath string, verifier *checksumVerifier, resumeFrom int64) error {
+	body, resumed, err := activeLister.FetchRange(fileURL, resumeFrom)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if !resumed {
+		resumeFrom = 0
+	}
+	return downloadToPartFile(body, partPath, resumed, resumeFrom, verifier)
+}
+
+// crawlGeneric is the crawl path used for every Lister backend other than
+// plain HTTP: it already knows whether an entry is a directory from its
+// parent's List() call, so (unlike crawl) it never needs to fetch a URL
+// just to sniff its content type.
+func crawlGeneric(item *QueueItem, queue chan *QueueItem, baseFolder string) {
+	url := item.url
+	fmt.Printf("Handling URL %s\n", url.String())
+	if !activeRobots.Allowed(url.Path) {
+		fmt.Printf("%s disallowed by robots.txt, skipping.\n", url.String())
+		return
+	}
+	if _, loaded := visited.LoadOrStore(url.String(), true); loaded {
+		fmt.Printf("%s visited before.\n", url.String())
+		return
+	}
+	// activeLister.List/FetchRange below throttle and re-check
+	// robots.txt themselves for the URL they actually fetch, so every
+	// request (directory listing, each download retry, checksum
+	// sidecars) is covered individually instead of once per item here.
+
+	relPath := getFileRelPath(url)
+	fullPath := filepath.Join(baseFolder, relPath)
+
+	if !item.isDir {
+		partPath := fullPath + partialSuffix
+		var resumeFrom int64
+		if stat, err := os.Stat(partPath); err == nil {
+			resumeFrom = stat.Size()
+		}
+
+		fmt.Printf("Downloading %s -> %s (resuming from byte %d)\n", url.String(), fullPath, resumeFrom)
+
+		if !dry {
+			verifier := newChecksumVerifier(url)
+			verifyErr := fetchAndVerify(url, partPath, verifier, resumeFrom)
+			for attempt := 0; verifyErr != nil && attempt < maxRetries; attempt++ {
+				log.Printf("Checksum verification of %s failed (attempt %d/%d): %v, retrying from scratch\n", fullPath, attempt+1, maxRetries+1, verifyErr)
+				// Remove whatever's left at partPath before retrying from
+				// scratch: fetchAndVerify only truncates it when its Lister
+				// reports the fetch as unresumed, and a backend that gets
+				// that wrong (or changes its mind between attempts) must
+				// not be allowed to silently append onto a previous
+				// failed attempt's bytes.
+				os.Remove(partPath)
+				verifier = newChecksumVerifier(url)
+				verifyErr = fetchAndVerify(url, partPath, verifier, 0)
+			}
+			if verifyErr != nil {
+				os.Remove(partPath)
+				log.Printf("Checksum verification of %s failed after %d attempt(s): %v\n", fullPath, maxRetries+1, verifyErr)
+				return
+			}
+		} else {
+			fmt.Println("Dry run (not actually downloading)")
+		}
+
+		if err := os.Rename(partPath, fullPath); err != nil {
+			log.Printf("Move %s -> %s failed: %v\n", partPath, fullPath, err)
+			return
+		}
+		if !item.remoteModTime.IsZero() {
+			if err := os.Chtimes(fullPath, item.remoteModTime, item.remoteModTime); err != nil {
+				log.Printf("Chtimes %s failed: %v\n", fullPath, err)
+			}
+		}
+		return
+	}
+
+	if err := os.MkdirAll(fullPath, 0755); err != nil {
+		log.Printf("Create %s failed: %v\n", fullPath, err)
+		return
+	}
+
+	remote, err := activeLister.List(url)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	remoteList := make([]RemoteFile, 0, len(remote))
+	remoteIsDir := make(map[string]bool, len(remote))
+	for _, e := range remote {
+		name := filepath.Join(relPath, e.Name)
+		size := e.Size
+		modTime := e.ModTime
+		if e.IsDir {
+			size = -1
+			modTime = time.Time{}
+		}
+		remoteList = append(remoteList, RemoteFile{Name: name, Size: size, ModTime: modTime, ModTimeMinuteOnly: e.ModTimeMinuteOnly})
+		remoteIsDir[name] = e.IsDir
+	}
+
+	localFileInfoList, err := ioutil.ReadDir(fullPath)
+	if err != nil {
+		log.Printf("Error when reading folder %s: %v\n", fullPath, err)
+		return
+	}
+	var localList []File
+	for _, file := range localFileInfoList {
+		if isSidecarFile(file.Name()) {
+			continue
+		}
+		localList = append(localList, File{
+			name:    filepath.Join(relPath, file.Name()),
+			isDir:   file.IsDir(),
+			size:    file.Size(),
+			modTime: file.ModTime(),
+		})
+	}
+
+	syncList, removeList := getSyncAndRemoveList(remoteList, localList)
+	for _, name := range removeList {
+		fullName := filepath.Join(baseFolder, name)
+		if err := os.RemoveAll(fullName); err != nil {
+			log.Printf("Failed to remove old file %s: %v\n", fullName, err)
+		} else {
+			log.Printf("Old file %s successfully removed.\n", fullName)
+		}
+	}
+
+	for _, syncItem := range syncList {
+		childURL, err := urlBuilder(boundaryPrefixURL, syncItem.name)
+		if err != nil {
+			log.Printf("Failed when building URL %s with %s: %v\n", url.String(), syncItem.name, err)
+			continue
+		}
+		log.Printf("Add %s to queue\n", childURL.String())
+		queue <- &QueueItem{url: childURL, localModTime: syncItem.localModTime, remoteModTime: syncItem.remoteModTime, isDir: remoteIsDir[syncItem.name]}
+	}
+}
+
+func parseAndPush(targetString string, queue chan *QueueItem, addTrailingSlash bool) error {
 	target, err := url.Parse(targetString)
 	if err != nil {
 		return err
@@ -173,15 +516,35 @@ func parseAndPush(targetString string, queue chan *url.URL, addTrailingSlash boo
 	if addTrailingSlash {
 		addTrailingSlashForAbsURL(target)
 	}
-	queue <- target
+	queue <- &QueueItem{url: target, isDir: true}
 	return nil
 }
 
 func main() {
 	bindIP := flag.String("bind", "", "The IP address that traverse binds to when downloading data.")
 	workersNum := flag.Int("workers", 1, "The number of workers (goroutine for crawling)")
+	source := flag.String("source", "http", "The listing/fetch backend to use: http, ftp or s3.")
+	verifyFlag := flag.String("verify", "auto", "Checksum verification mode: auto, strict or off.")
+	maxRetriesFlag := flag.Int("max-retries", 0, "Maximum retries for transient network errors, with exponential backoff.")
+	userAgent := flag.String("user-agent", fmt.Sprintf("tsumugu/%s", version), "User-Agent header sent with every request.")
+	rateLimit := flag.Float64("rate-limit", 0, "Global max requests/sec per host, independent of robots.txt Crawl-delay (0 = unlimited).")
 	flag.Parse()
 
+	lister, err := NewLister(*source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	activeLister = lister
+
+	verifyMode, err := parseVerifyMode(*verifyFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	verify = verifyMode
+
+	maxRetries = *maxRetriesFlag
+	globalRateLimit = *rateLimit
+
 	if *bindIP == "" {
 		StandardClient = &http.Client{}
 	} else {
@@ -201,8 +564,9 @@ func main() {
 			},
 		}
 	}
+	StandardClient.Transport = &userAgentRoundTripper{next: StandardClient.Transport, userAgent: *userAgent}
 
-	var queue = make(chan *url.URL, 1024)
+	var queue = make(chan *QueueItem, 1024)
 	var tokens = make(chan struct{}, *workersNum)
 	var cnt int64
 
@@ -225,14 +589,16 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	activeRobots = fetchRobots(base, *userAgent)
 	for {
 		select {
-		case url := <-queue:
+		case item := <-queue:
 			atomic.AddInt64(&cnt, 1)
 			go func() {
 				tokens <- struct{}{}
 				defer atomic.AddInt64(&cnt, -1)
-				crawl(url, queue, "/tmp/test")
+				crawl(item, queue, "/tmp/test")
 				<-tokens
 			}()
 		default:
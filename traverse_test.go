@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsSidecarFile(t *testing.T) {
+	cases := map[string]bool{
+		"foo.tar.gz":              false,
+		"foo.tar.gz.tsumugu-part": true,
+		"foo.tar.gz.tsumugu-etag": true,
+	}
+	for name, want := range cases {
+		if got := isSidecarFile(name); got != want {
+			t.Errorf("isSidecarFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestSaveAndReadLocalETag(t *testing.T) {
+	dir := t.TempDir()
+	fullPath := filepath.Join(dir, "foo.tar.gz")
+	if err := os.WriteFile(fullPath, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saveLocalETag(fullPath, http.Header{"Etag": {`"abc123"`}})
+	if got := readLocalETag(fullPath); got != `"abc123"` {
+		t.Errorf("expected saved ETag to round-trip, got %q", got)
+	}
+
+	saveLocalETag(fullPath, http.Header{})
+	if got := readLocalETag(fullPath); got != "" {
+		t.Errorf("expected stale ETag sidecar to be removed when a later response has none, got %q", got)
+	}
+}
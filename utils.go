@@ -7,7 +7,9 @@ import (
 	"net/url"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
@@ -15,31 +17,113 @@ import (
 
 var suffixHTMLMatch = regexp.MustCompile(`(?i)(.+)index.html?$`)
 
-func getHrefsFromHTML(body io.ReadCloser) []string {
-	var hrefs []string
+// autoindexMetaMatch pulls the "dd-Mon-yyyy HH:MM  size" pair that Apache's
+// mod_autoindex, nginx's autoindex module and lighttpd's dirlisting module
+// all print after each link.
+var autoindexMetaMatch = regexp.MustCompile(`(\d{2}-[A-Za-z]{3}-\d{4}\s+\d{2}:\d{2})\s+(-|[\d.]+[KMGT]?)(?:\s|$)`)
+
+// RemoteFile is a single entry (file or directory) found in a directory
+// listing. Size and ModTime are populated from the autoindex text trailing
+// the link when available; Size is -1 and ModTime is the zero value when
+// the listing didn't provide them. ModTimeMinuteOnly is true when ModTime
+// came from the HTML autoindex path, whose "dd-Mon-yyyy HH:MM" format is
+// only minute-precise - see isRemoteFileUpToDate.
+type RemoteFile struct {
+	Name              string
+	Size              int64
+	ModTime           time.Time
+	ModTimeMinuteOnly bool
+}
+
+// getEntriesFromHTML walks an autoindex-style directory listing and returns
+// every linked entry together with whatever size/mtime metadata is printed
+// next to it.
+func getEntriesFromHTML(body io.ReadCloser) []RemoteFile {
+	var entries []RemoteFile
+	var pending *RemoteFile
+	var trailing strings.Builder
+
+	flush := func() {
+		if pending == nil {
+			return
+		}
+		parseAutoindexMetadata(trailing.String(), pending)
+		entries = append(entries, *pending)
+		pending = nil
+		trailing.Reset()
+	}
+
 	tokenizer := html.NewTokenizer(body)
 	for {
 		token := tokenizer.Next()
 
 		switch {
 		case token == html.ErrorToken:
-			return hrefs
+			flush()
+			return entries
 		case token == html.StartTagToken:
 			current := tokenizer.Token()
 
 			if current.DataAtom == atom.A {
+				flush()
 				for _, a := range current.Attr {
 					if a.Key == "href" && a.Val != "../" && a.Val != "Parent Directory" {
-						// fmt.Println(a.Val)
-						hrefs = append(hrefs, a.Val)
+						pending = &RemoteFile{Name: a.Val, Size: -1}
 						break
 					}
 				}
 			}
+		case token == html.TextToken:
+			if pending != nil {
+				trailing.WriteString(tokenizer.Token().Data)
+				trailing.WriteString(" ")
+			}
 		}
 	}
 }
 
+// parseAutoindexMetadata extracts the size/mtime pair (if any) from the text
+// following a listing's anchor and fills them into entry.
+func parseAutoindexMetadata(text string, entry *RemoteFile) {
+	matches := autoindexMetaMatch.FindStringSubmatch(text)
+	if matches == nil {
+		return
+	}
+	if modTime, err := time.Parse("02-Jan-2006 15:04", matches[1]); err == nil {
+		entry.ModTime = modTime
+	}
+	if size, ok := parseAutoindexSize(matches[2]); ok {
+		entry.Size = size
+	}
+}
+
+// parseAutoindexSize turns an autoindex size field ("-", "1234" or "1.2K")
+// into a byte count. ok is false when the size wasn't reported ("-").
+func parseAutoindexSize(s string) (int64, bool) {
+	if s == "-" {
+		return 0, false
+	}
+	multiplier := float64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	case 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(value * multiplier), true
+}
+
 func urlBuilder(base *url.URL, href string) (*url.URL, error) {
 	res, err := base.Parse(href)
 	return res, err
@@ -115,39 +199,60 @@ func getFileRelPath(url *url.URL) string {
 	return strings.TrimPrefix(url.Path, boundaryPrefix)
 }
 
-func generateRemoteFileList(url *url.URL, hrefs []string) []string {
-	var list []string
-	for _, href := range hrefs {
-		newURL, err := urlBuilder(url, href)
+func generateRemoteFileList(url *url.URL, entries []RemoteFile) []RemoteFile {
+	var list []RemoteFile
+	for _, entry := range entries {
+		newURL, err := urlBuilder(url, entry.Name)
 		if err != nil {
 			continue
 		}
-		name := getFileRelPath(newURL)
-		list = append(list, name)
+		list = append(list, RemoteFile{
+			Name:              getFileRelPath(newURL),
+			Size:              entry.Size,
+			ModTime:           entry.ModTime,
+			ModTimeMinuteOnly: true,
+		})
 	}
 	return list
 }
 
-func getSyncAndRemoveList(remoteList []string, localList []File) ([]string, []string) {
+// SyncItem is a remote entry that needs to be fetched. localModTime is the
+// zero value for brand-new entries, and the existing local file's mtime
+// when we're merely re-checking a file the listing couldn't fully vouch
+// for - letting the fetch be made conditional (If-Modified-Since).
+// remoteModTime is the listing's ModTime for the entry (zero if the
+// listing didn't report one), so the downloader can stamp it onto the
+// file it writes.
+type SyncItem struct {
+	name          string
+	localModTime  time.Time
+	remoteModTime time.Time
+}
+
+func getSyncAndRemoveList(remoteList []RemoteFile, localList []File) ([]SyncItem, []string) {
 	remoteMap := make(map[string]struct{}, len(remoteList))
-	localMap := make(map[string]bool, len(localList))
+	localMap := make(map[string]File, len(localList))
 
-	for _, x := range remoteList {
-		remoteMap[x] = struct{}{}
-	}
 	for _, y := range localList {
-		localMap[y.name] = y.isDir
+		localMap[y.name] = y
 	}
 
-	var syncList []string
+	var syncList []SyncItem
 	var removeList []string
 
 	for _, x := range remoteList {
-		isDir, found := localMap[x]
-		if !found {
-			syncList = append(syncList, x)
-		} else if isDir {
-			syncList = append(syncList, x)
+		remoteMap[x.Name] = struct{}{}
+		local, found := localMap[x.Name]
+		switch {
+		case !found:
+			syncList = append(syncList, SyncItem{name: x.Name, remoteModTime: x.ModTime})
+		case local.isDir:
+			// directories are always walked, there's nothing to compare.
+			syncList = append(syncList, SyncItem{name: x.Name, remoteModTime: x.ModTime})
+		case isRemoteFileUpToDate(x, local):
+			// size and mtime already match what we have on disk.
+		default:
+			syncList = append(syncList, SyncItem{name: x.Name, localModTime: local.modTime, remoteModTime: x.ModTime})
 		}
 	}
 	for _, y := range localList {
@@ -159,6 +264,30 @@ func getSyncAndRemoveList(remoteList []string, localList []File) ([]string, []st
 	return syncList, removeList
 }
 
+// isRemoteFileUpToDate reports whether a local file can be trusted to
+// already match a remote listing entry, without fetching it again. This
+// relies on crawl/crawlGeneric having stamped the local file's mtime with
+// the remote's ModTime when it was downloaded (see os.Chtimes calls
+// there), so a local mtime older than the listing's means the remote was
+// updated since our last sync.
+func isRemoteFileUpToDate(remote RemoteFile, local File) bool {
+	if remote.Size < 0 || remote.ModTime.IsZero() {
+		return false
+	}
+	if remote.Size != local.size {
+		return false
+	}
+	localModTime := local.modTime
+	if remote.ModTimeMinuteOnly {
+		// autoindex listings only have minute-level precision, so fuzz
+		// the comparison accordingly; ftp/s3 report real second-precision
+		// mtimes and must be compared exactly, or an up-to-date file with
+		// nonzero seconds would look stale on every run.
+		localModTime = localModTime.Truncate(time.Minute)
+	}
+	return !localModTime.Before(remote.ModTime)
+}
+
 func getMemUsage() uint64 {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
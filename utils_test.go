@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func baseURLTest(base string, href string, expected string, t *testing.T) {
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := urlBuilder(u, href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual.String() != expected {
+		t.Errorf("Expected %s, got %s. base = %s, href = %s\n", expected, actual.String(), base, href)
+	}
+}
+
+func TestUrlBuilder(t *testing.T) {
+	baseURLTest("https://download.docker.com", "linux", "https://download.docker.com/linux", t)
+	baseURLTest("https://download.docker.com/linux/", "centos/", "https://download.docker.com/linux/centos/", t)
+}
+
+func TestGetEntriesFromHTMLApache(t *testing.T) {
+	html := `<pre><a href="foo.tar.gz">foo.tar.gz</a>            26-Jul-2023 10:23  1.2K
+<a href="subdir/">subdir/</a>               26-Jul-2023 10:24    -
+</pre>`
+	entries := getEntriesFromHTML(ioutil.NopCloser(strings.NewReader(html)))
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	want := time.Date(2023, time.July, 26, 10, 23, 0, 0, time.UTC)
+	if entries[0].Name != "foo.tar.gz" || entries[0].Size != 1228 || !entries[0].ModTime.Equal(want) {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+	if entries[1].Name != "subdir/" || entries[1].Size != -1 {
+		t.Errorf("unexpected entry: %+v", entries[1])
+	}
+}
+
+func TestIsRemoteFileUpToDate(t *testing.T) {
+	remote := RemoteFile{Size: 100, ModTime: time.Date(2023, time.July, 26, 10, 23, 0, 0, time.UTC)}
+
+	// local file was stamped with the remote's mtime on a previous sync,
+	// and the remote hasn't changed since: no need to re-fetch.
+	upToDate := File{size: 100, modTime: remote.ModTime}
+	if !isRemoteFileUpToDate(remote, upToDate) {
+		t.Errorf("expected file stamped with remote's own mtime to be up to date")
+	}
+
+	// the remote was updated after our last sync: must re-fetch, even
+	// though the size happens to still match.
+	stale := File{size: 100, modTime: remote.ModTime.Add(-time.Hour)}
+	if isRemoteFileUpToDate(remote, stale) {
+		t.Errorf("expected file older than remote's mtime to be considered stale")
+	}
+
+	// size mismatch always forces a re-fetch regardless of mtime.
+	wrongSize := File{size: 99, modTime: remote.ModTime}
+	if isRemoteFileUpToDate(remote, wrongSize) {
+		t.Errorf("expected size mismatch to be considered stale")
+	}
+}
+
+func TestIsRemoteFileUpToDatePrecision(t *testing.T) {
+	// ftp/s3 report real second-precision mtimes, so a local file whose
+	// mtime differs within the same minute must still be treated as
+	// stale - unlike the autoindex case, there's no minute-only format
+	// to excuse the mismatch.
+	remote := RemoteFile{Size: 100, ModTime: time.Date(2023, time.July, 26, 10, 23, 30, 0, time.UTC)}
+	local := File{size: 100, modTime: remote.ModTime.Truncate(time.Minute)}
+	if isRemoteFileUpToDate(remote, local) {
+		t.Errorf("expected second-precision source to be compared exactly, not fuzzed to the minute")
+	}
+
+	// the same local file is correctly considered up to date once the
+	// source is known to only have minute precision.
+	remote.ModTimeMinuteOnly = true
+	remote.ModTime = remote.ModTime.Truncate(time.Minute)
+	if !isRemoteFileUpToDate(remote, local) {
+		t.Errorf("expected minute-precision source to tolerate a local mtime truncated to the minute")
+	}
+}
+
+func TestParseAutoindexSize(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected int64
+		ok       bool
+	}{
+		{"-", 0, false},
+		{"123", 123, true},
+		{"1.2K", 1228, true},
+		{"3M", 3 * 1 << 20, true},
+	}
+	for _, c := range cases {
+		size, ok := parseAutoindexSize(c.in)
+		if ok != c.ok || size != c.expected {
+			t.Errorf("parseAutoindexSize(%q) = (%d, %v), want (%d, %v)", c.in, size, ok, c.expected, c.ok)
+		}
+	}
+}